@@ -0,0 +1,33 @@
+package modules
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// UploadParams contains the information used by the renter to negotiate
+// upload contracts with hosts and to erasure-code the file being uploaded.
+type UploadParams struct {
+	// Filename is the path, on disk, of the file to be uploaded.
+	Filename string
+
+	// Nickname is the name under which the uploaded file is tracked by the
+	// renter.
+	Nickname string
+
+	// Duration is the number of blocks the uploaded data should be stored
+	// for, starting from the height at which the upload begins.
+	Duration types.BlockHeight
+
+	// Pieces is not used by the renter's Upload, which always erasure-codes
+	// the file according to DataPieces and ParityPieces.
+	Pieces int
+
+	// DataPieces and ParityPieces are the erasure-coding parameters for the
+	// upload: the file is split into DataPieces shards, plus ParityPieces
+	// shards of parity, and each shard is sent to a randomly chosen host;
+	// hosts are not checked to be distinct, so two shards may share a host.
+	// The file can be recovered from any DataPieces of the
+	// DataPieces+ParityPieces shards.
+	DataPieces   int
+	ParityPieces int
+}
@@ -0,0 +1,217 @@
+package renter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// shardSuffix returns the filename suffix used for a shard's temporary,
+// resumable download file.
+func shardSuffix(shardIndex int) string {
+	return fmt.Sprintf(".shard%d", shardIndex)
+}
+
+const (
+	// downloadChunkSize is the size, in bytes, of the pieces that a shard is
+	// split into for download purposes. Each chunk is verified against the
+	// shard's Merkle root independently, so a network blip or a host
+	// truncating the stream only costs the in-flight chunk rather than the
+	// entire shard.
+	downloadChunkSize = 1 << 20 // 1 MiB
+
+	// maxDownloadAttempts is the total number of attempts (the first one plus
+	// resumes) made at a shard's chunked download against the same host
+	// before the shard is abandoned.
+	maxDownloadAttempts = 3
+)
+
+// chunkBitmap tracks, one bit per chunk, which chunks of a shard have been
+// downloaded and verified so far. It is persisted alongside the partially
+// downloaded shard so that a restart can resume instead of starting over.
+type chunkBitmap []byte
+
+func newChunkBitmap(numChunks int) chunkBitmap {
+	return make(chunkBitmap, (numChunks+7)/8)
+}
+
+func (b chunkBitmap) Get(i int) bool {
+	return b[i/8]&(1<<uint(i%8)) != 0
+}
+
+func (b chunkBitmap) Set(i int) {
+	b[i/8] |= 1 << uint(i%8)
+}
+
+func (b chunkBitmap) Complete(numChunks int) bool {
+	for i := 0; i < numChunks; i++ {
+		if !b.Get(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// shardSidecarPath returns the path of the .siapart sidecar that tracks
+// download progress for a shard's partial file.
+func shardSidecarPath(shardPath string) string {
+	return shardPath + ".siapart"
+}
+
+// chunkRoots splits shard into downloadChunkSize-sized chunks and returns the
+// Merkle root of each, in order. It is called at upload time, before a
+// shard's bytes are handed off to negotiateContract, so that FilePiece can
+// record a commitment for each chunk at the same granularity the chunked
+// download protocol fetches data in.
+//
+// piece.Contract.FileMerkleRoot is computed over the whole shard at a much
+// finer segment granularity (see crypto.ReaderMerkleRoot), so a proof against
+// it can't be checked one downloadChunkSize chunk at a time - the tree
+// shapes don't match. Committing to each chunk's own root up front sidesteps
+// that mismatch entirely: the host has no opportunity to substitute a chunk,
+// since the renter already knows what every chunk's root must be.
+func chunkRoots(shard []byte) []crypto.Hash {
+	numChunks := (len(shard) + downloadChunkSize - 1) / downloadChunkSize
+	roots := make([]crypto.Hash, numChunks)
+	for i := range roots {
+		start := i * downloadChunkSize
+		end := start + downloadChunkSize
+		if end > len(shard) {
+			end = len(shard)
+		}
+		root, err := crypto.ReaderMerkleRoot(bytes.NewReader(shard[start:end]))
+		if err != nil {
+			// shard is an in-memory slice; ReaderMerkleRoot can't fail
+			// reading from it.
+			panic(err)
+		}
+		roots[i] = root
+	}
+	return roots
+}
+
+// loadChunkBitmap loads the bitmap for a partial download from its sidecar,
+// or creates a fresh one if no sidecar exists yet.
+func loadChunkBitmap(shardPath string, numChunks int) chunkBitmap {
+	data, err := ioutil.ReadFile(shardSidecarPath(shardPath))
+	if err != nil {
+		return newChunkBitmap(numChunks)
+	}
+	var bitmap chunkBitmap
+	if err := encoding.Unmarshal(data, &bitmap); err != nil || len(bitmap) != (numChunks+7)/8 {
+		return newChunkBitmap(numChunks)
+	}
+	return bitmap
+}
+
+func saveChunkBitmap(shardPath string, bitmap chunkBitmap) error {
+	return ioutil.WriteFile(shardSidecarPath(shardPath), encoding.Marshal(bitmap), 0666)
+}
+
+// downloadPiece retrieves a single erasure-coded shard from its host in
+// fixed-size chunks, verifying each chunk as it arrives against the
+// corresponding entry of piece.ChunkRoots (computed by the uploader, at the
+// same downloadChunkSize granularity, before the shard was ever sent to a
+// host) and writing it to shardPath at the correct offset via WriteAt.
+// Progress is tracked in a .siapart sidecar, so a prior partial download of
+// the same shard is resumed rather than restarted: on any RPC error, the
+// caller can invoke downloadPiece again (potentially after the transient
+// condition has cleared) and only the missing chunks will be fetched.
+func (r *Renter) downloadPiece(piece FilePiece, shardPath string) ([]byte, error) {
+	fileSize := int64(piece.Contract.FileSize)
+	numChunks := int((fileSize + downloadChunkSize - 1) / downloadChunkSize)
+	if len(piece.ChunkRoots) != numChunks {
+		return nil, errors.New("piece is missing per-chunk Merkle roots")
+	}
+	bitmap := loadChunkBitmap(shardPath, numChunks)
+
+	file, err := os.OpenFile(shardPath, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	err = r.gateway.RPC(piece.HostIP, "RetrieveFileChunked", func(conn modules.NetConn) (err error) {
+		if err = conn.WriteObject(piece.ContractID); err != nil {
+			return
+		}
+		for i := 0; i < numChunks; i++ {
+			if bitmap.Get(i) {
+				// Already downloaded and verified in a previous attempt.
+				continue
+			}
+
+			offset := int64(i) * downloadChunkSize
+			chunkLen := int64(downloadChunkSize)
+			if remaining := fileSize - offset; remaining < chunkLen {
+				chunkLen = remaining
+			}
+
+			// Ask for this chunk specifically, so a resumed download only
+			// pays for the chunks it's missing.
+			if err = conn.WriteObject(uint64(i)); err != nil {
+				return
+			}
+
+			var chunk []byte
+			if err = conn.ReadObject(&chunk, downloadChunkSize); err != nil {
+				return
+			}
+			if int64(len(chunk)) != chunkLen {
+				return errors.New("host sent a chunk of the wrong length")
+			}
+			chunkRoot, rootErr := crypto.ReaderMerkleRoot(bytes.NewReader(chunk))
+			if rootErr != nil {
+				return rootErr
+			}
+			if chunkRoot != piece.ChunkRoots[i] {
+				return errors.New("host provided a chunk that's invalid")
+			}
+
+			if _, err = file.WriteAt(chunk, offset); err != nil {
+				return
+			}
+			bitmap.Set(i)
+			if err = saveChunkBitmap(shardPath, bitmap); err != nil {
+				return
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	shard, err := ioutil.ReadFile(shardPath)
+	if err != nil {
+		return nil, err
+	}
+	// The shard is fully downloaded and verified; the partial-download
+	// bookkeeping is no longer needed.
+	os.Remove(shardPath)
+	os.Remove(shardSidecarPath(shardPath))
+	return shard, nil
+}
+
+// downloadPieceResumable calls downloadPiece up to maxDownloadAttempts times,
+// resuming from the .siapart sidecar on each retry. If every attempt fails -
+// for example because the host has gone offline mid-stream - the shard is
+// abandoned and the caller is expected to reconstruct it from the other
+// erasure-coded shards instead.
+func (r *Renter) downloadPieceResumable(piece FilePiece, shardPath string) ([]byte, error) {
+	var err error
+	for attempt := 0; attempt < maxDownloadAttempts; attempt++ {
+		var shard []byte
+		shard, err = r.downloadPiece(piece, shardPath)
+		if err == nil {
+			return shard, nil
+		}
+	}
+	return nil, err
+}
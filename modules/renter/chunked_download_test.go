@@ -0,0 +1,68 @@
+package renter
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestChunkBitmap verifies the Get/Set/Complete bit-tracking logic used to
+// resume a partially downloaded shard across restarts.
+func TestChunkBitmap(t *testing.T) {
+	const numChunks = 13 // not a multiple of 8, to exercise the trailing byte
+	bitmap := newChunkBitmap(numChunks)
+
+	if bitmap.Complete(numChunks) {
+		t.Fatal("a freshly created bitmap should not be complete")
+	}
+
+	for i := 0; i < numChunks; i++ {
+		if bitmap.Get(i) {
+			t.Fatalf("chunk %v should not be set yet", i)
+		}
+	}
+
+	for i := 0; i < numChunks-1; i++ {
+		bitmap.Set(i)
+	}
+	if bitmap.Complete(numChunks) {
+		t.Fatal("bitmap should not be complete with one chunk missing")
+	}
+	for i := 0; i < numChunks-1; i++ {
+		if !bitmap.Get(i) {
+			t.Fatalf("chunk %v should be set", i)
+		}
+	}
+
+	bitmap.Set(numChunks - 1)
+	if !bitmap.Complete(numChunks) {
+		t.Fatal("bitmap should be complete once every chunk is set")
+	}
+}
+
+// TestChunkRoots verifies that chunkRoots splits a shard into the expected
+// number of downloadChunkSize-sized pieces, that each root is reproducible,
+// and that flipping the shard's first byte changes the first chunk's root
+// while leaving the second chunk's root unchanged.
+func TestChunkRoots(t *testing.T) {
+	shard := bytes.Repeat([]byte{0x42}, downloadChunkSize+1) // spans two chunks
+
+	roots := chunkRoots(shard)
+	if len(roots) != 2 {
+		t.Fatalf("expected 2 chunks for a shard of length %v, got %v", len(shard), len(roots))
+	}
+
+	again := chunkRoots(shard)
+	if roots[0] != again[0] || roots[1] != again[1] {
+		t.Fatal("chunkRoots is not deterministic for identical input")
+	}
+
+	tampered := append([]byte(nil), shard...)
+	tampered[0] ^= 0xFF
+	tamperedRoots := chunkRoots(tampered)
+	if tamperedRoots[0] == roots[0] {
+		t.Fatal("tampering with the first chunk's data should change its root")
+	}
+	if tamperedRoots[1] != roots[1] {
+		t.Fatal("tampering with the first chunk's data should not change the second chunk's root")
+	}
+}
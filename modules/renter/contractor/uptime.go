@@ -1,6 +1,7 @@
 package contractor
 
 import (
+	"math"
 	"sort"
 	"time"
 
@@ -13,7 +14,21 @@ import (
 // host is offline or not.
 const uptimeMinScans = 3
 
-// uptimeWindow specifies the duration in which host uptime is checked.
+// offlineScoreThreshold is the score, on the same scale produced by
+// hostScore, below which a host is considered offline. It is deliberately
+// low: hostScore decays gracefully, so a host only crosses this threshold
+// after a sustained run of failures.
+const offlineScoreThreshold = 0.05
+
+// burstPenaltyScans is the number of most recent scans examined for a
+// short-term failure burst, and burstPenaltyFactor is the multiplier applied
+// to the score for each failure found among them.
+const burstPenaltyScans = 3
+
+var burstPenaltyFactor = 0.5
+
+// uptimeWindow specifies the duration in which host uptime is checked. It is
+// also used as the half-life of the EWMAs that feed into hostScore.
 var uptimeWindow = func() time.Duration {
 	switch build.Release {
 	case "dev":
@@ -31,18 +46,35 @@ var uptimeWindow = func() time.Duration {
 func (c *Contractor) IsOffline(id types.FileContractID) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.isOffline(id)
+	return c.hostScore(id) < offlineScoreThreshold
 }
 
-// isOffline indicates whether a contract's host should be considered offline,
-// based on its scan metrics.
-func (c *Contractor) isOffline(id types.FileContractID) bool {
+// hostScore returns a quantitative score in [0,1] for the host behind a
+// contract, combining two signals:
+//
+//  1. an EWMA of scan success, with half-life uptimeWindow, so that older
+//     scans count for less than recent ones instead of falling off a cliff
+//     once they age out of a fixed window; and
+//  2. a multiplicative penalty for a short-term burst of failures among the
+//     most recent scans, so a host that just started failing is downranked
+//     quickly even if its long-run average is still good.
+//
+// A latency term was originally part of this score, but modules.HostDBScan
+// only ever carries Timestamp and Success - there's no RTT field anywhere in
+// the scan-recording code to feed it - so it's left out until that plumbing
+// exists rather than scoring every host against a constant.
+//
+// A score of 0 means the host should be treated as offline; a score near 1
+// means the host has been reliably reachable. This replaces the
+// binary isOffline check with something the renter can rank hosts by,
+// preferring the best of many rather than cutting off at a single threshold.
+func (c *Contractor) hostScore(id types.FileContractID) float64 {
 	// Get the net address associated with the contract.
 	//
 	// TODO: This should eventually be updated to query the host by public key.
 	contract, exists := c.contracts[id]
 	if !exists {
-		return false
+		return 0
 	}
 	addr := contract.NetAddress
 	// Look up the host by address.
@@ -50,7 +82,7 @@ func (c *Contractor) isOffline(id types.FileContractID) bool {
 	// TODO: Eventually the host should be getting queried by public key.
 	host, ok := c.hdb.Host(addr)
 	if !ok {
-		return false
+		return 0
 	}
 
 	// Sanity check - ScanHistory should always be ordered from oldest to
@@ -60,43 +92,99 @@ func (c *Contractor) isOffline(id types.FileContractID) bool {
 		build.Critical("host's scan history was not sorted")
 	}
 
-	// consider a host offline if:
-	// 1) The host has been scanned at least three times, and
-	// 2) The three most recent scans have all failed, and
-	// 3) The time between the most recent scan and the last successful scan
-	//    (or first scan) is at least uptimeWindow
 	numScans := len(host.ScanHistory)
 	if numScans < uptimeMinScans {
-		// not enough data to make a fair judgment
-		return false
+		// not enough data to make a fair judgment; treat the host
+		// optimistically until it has a track record
+		return 1
 	}
-	recent := host.ScanHistory[numScans-uptimeMinScans:]
-	for _, scan := range recent {
+
+	// Walk the scan history oldest-to-newest, maintaining an EWMA of scan
+	// success weighted by the time elapsed since the previous scan relative
+	// to uptimeWindow. The EWMA is seeded from the first scan's actual value
+	// rather than a fixed constant, so that a host scanned much more often
+	// than uptimeWindow apart (the normal case) doesn't have that first
+	// scan's real data overwhelmed by a weight-1 step against a placeholder
+	// seed.
+	successValue := func(scan modules.HostDBScan) float64 {
 		if scan.Success {
-			// one of the scans succeeded
-			return false
+			return 1.0
 		}
+		return 0.0
+	}
+
+	uptimeEWMA := successValue(host.ScanHistory[0])
+	prev := host.ScanHistory[0]
+	for _, scan := range host.ScanHistory[1:] {
+		elapsed := scan.Timestamp.Sub(prev.Timestamp)
+		weight := ewmaWeight(elapsed, uptimeWindow)
+
+		uptimeEWMA = weight*uptimeEWMA + (1-weight)*successValue(scan)
+
+		prev = scan
 	}
-	// initialize window bounds
-	windowStart, windowEnd := host.ScanHistory[0].Timestamp, host.ScanHistory[numScans-1].Timestamp
-	// iterate from newest-oldest, seeking to last successful scan
-	for i := numScans - 1; i >= 0; i-- {
-		if scan := host.ScanHistory[i]; scan.Success {
-			windowStart = scan.Timestamp
-			break
+
+	// Apply a burst penalty: each failure among the most recent
+	// burstPenaltyScans scans multiplies the score down further, so a host
+	// that just started failing drops quickly rather than waiting for the
+	// EWMA to catch up.
+	burstPenalty := 1.0
+	recent := host.ScanHistory[numScans-min(numScans, burstPenaltyScans):]
+	for _, scan := range recent {
+		if !scan.Success {
+			burstPenalty *= burstPenaltyFactor
 		}
 	}
-	return windowEnd.Sub(windowStart) >= uptimeWindow
+
+	return uptimeEWMA * burstPenalty
 }
 
-// onlineContracts returns the subset of the Contractor's contracts whose
-// hosts are considered online.
-func (c *Contractor) onlineContracts() []modules.RenterContract {
-	var cs []modules.RenterContract
+// ewmaWeight returns the decay weight to give the previous EWMA value after
+// 'elapsed' has passed, such that the weight is 0.5 when elapsed equals
+// halfLife.
+func ewmaWeight(elapsed, halfLife time.Duration) float64 {
+	if halfLife <= 0 {
+		return 0
+	}
+	return math.Exp(-math.Ln2 * float64(elapsed) / float64(halfLife))
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// RankedContracts returns the Contractor's contracts sorted from best to
+// worst host, so that callers (such as the renter's erasure-coded downloads)
+// can prefer the best-scoring hosts when more redundant pieces are available
+// than are strictly needed.
+func (c *Contractor) RankedContracts() []modules.RenterContract {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.rankedContracts()
+}
+
+// rankedContracts returns the Contractor's contracts sorted from best to
+// worst by hostScore, so that callers (such as erasure-coded downloads) can
+// pick the best k hosts rather than any k online ones.
+func (c *Contractor) rankedContracts() []modules.RenterContract {
+	type scoredContract struct {
+		contract modules.RenterContract
+		score    float64
+	}
+	scored := make([]scoredContract, 0, len(c.contracts))
 	for _, contract := range c.contracts {
-		if !c.isOffline(contract.ID) {
-			cs = append(cs, contract)
-		}
+		scored = append(scored, scoredContract{contract, c.hostScore(contract.ID)})
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	cs := make([]modules.RenterContract, len(scored))
+	for i, sc := range scored {
+		cs[i] = sc.contract
 	}
 	return cs
 }
@@ -0,0 +1,51 @@
+package contractor
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestEWMAWeightHalfLife verifies that ewmaWeight returns 0.5 when exactly
+// one half-life has elapsed, and that it decays monotonically as more time
+// passes - the property hostScore relies on to age out old scans gradually
+// instead of dropping them off a cliff.
+func TestEWMAWeightHalfLife(t *testing.T) {
+	const halfLife = time.Hour
+
+	weight := ewmaWeight(halfLife, halfLife)
+	if math.Abs(weight-0.5) > 1e-9 {
+		t.Fatalf("expected weight 0.5 at one half-life, got %v", weight)
+	}
+
+	if w := ewmaWeight(0, halfLife); math.Abs(w-1) > 1e-9 {
+		t.Fatalf("expected weight ~1 at zero elapsed time, got %v", w)
+	}
+
+	w2 := ewmaWeight(2*halfLife, halfLife)
+	if math.Abs(w2-0.25) > 1e-9 {
+		t.Fatalf("expected weight 0.25 at two half-lives, got %v", w2)
+	}
+
+	if !(1 > weight && weight > w2) {
+		t.Fatalf("weight should decay monotonically as elapsed time grows: got 1 > %v > %v", weight, w2)
+	}
+}
+
+// TestEWMAWeightZeroHalfLife verifies that a non-positive half-life (which
+// should never occur in practice, since uptimeWindow is a fixed positive
+// constant) doesn't cause a divide-by-zero panic.
+func TestEWMAWeightZeroHalfLife(t *testing.T) {
+	if w := ewmaWeight(time.Second, 0); w != 0 {
+		t.Fatalf("expected weight 0 for a non-positive half-life, got %v", w)
+	}
+}
+
+func TestMin(t *testing.T) {
+	if min(3, 5) != 3 {
+		t.Fatal("min(3, 5) should be 3")
+	}
+	if min(5, 3) != 3 {
+		t.Fatal("min(5, 3) should be 3")
+	}
+}
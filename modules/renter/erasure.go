@@ -0,0 +1,73 @@
+package renter
+
+import (
+	"errors"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// An erasureCoder splits data into equal-length pieces, with some number of
+// parity pieces, such that the original data can be recovered from any
+// sufficiently large subset of the pieces. It is a thin wrapper around the
+// reedsolomon package that deals in whole-file shards instead of matrices.
+type erasureCoder struct {
+	dataPieces   int
+	parityPieces int
+	enc          reedsolomon.Encoder
+}
+
+// newErasureCoder returns an erasureCoder that splits data into dataPieces
+// shards and generates parityPieces shards of parity, tolerating the loss of
+// up to parityPieces shards.
+func newErasureCoder(dataPieces, parityPieces int) (*erasureCoder, error) {
+	if dataPieces <= 0 || parityPieces < 0 {
+		return nil, errors.New("invalid erasure coding parameters")
+	}
+	enc, err := reedsolomon.New(dataPieces, parityPieces)
+	if err != nil {
+		return nil, err
+	}
+	return &erasureCoder{
+		dataPieces:   dataPieces,
+		parityPieces: parityPieces,
+		enc:          enc,
+	}, nil
+}
+
+// NumPieces returns the total number of pieces (data + parity) produced by
+// the erasureCoder.
+func (ec *erasureCoder) NumPieces() int {
+	return ec.dataPieces + ec.parityPieces
+}
+
+// Encode splits data into ec.NumPieces() shards, the first ec.dataPieces of
+// which are the original data (padded to a multiple of ec.dataPieces) and the
+// remainder of which are parity shards.
+func (ec *erasureCoder) Encode(data []byte) ([][]byte, error) {
+	shards, err := ec.enc.Split(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := ec.enc.Encode(shards); err != nil {
+		return nil, err
+	}
+	return shards, nil
+}
+
+// Recover reconstructs the original data of length n from a set of shards.
+// Shards that were not retrieved (or failed their Merkle check) should be
+// passed as nil; Recover will reconstruct them as long as at least
+// ec.dataPieces shards are present.
+func (ec *erasureCoder) Recover(shards [][]byte, n int) ([]byte, error) {
+	if err := ec.enc.Reconstruct(shards); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, n)
+	for _, s := range shards[:ec.dataPieces] {
+		buf = append(buf, s...)
+	}
+	if len(buf) < n {
+		return nil, errors.New("erasure coder: not enough data to reconstruct file")
+	}
+	return buf[:n], nil
+}
@@ -0,0 +1,70 @@
+package renter
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestErasureCoderRoundTrip verifies that data encoded by an erasureCoder can
+// be recovered even after losing up to parityPieces shards.
+func TestErasureCoderRoundTrip(t *testing.T) {
+	const dataPieces, parityPieces = 4, 2
+	ec, err := newErasureCoder(dataPieces, parityPieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte{0xAB}, 117) // not a multiple of dataPieces
+	shards, err := ec.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shards) != dataPieces+parityPieces {
+		t.Fatalf("expected %v shards, got %v", dataPieces+parityPieces, len(shards))
+	}
+
+	// Drop the maximum tolerable number of shards and confirm recovery still
+	// succeeds.
+	shards[0] = nil
+	shards[dataPieces] = nil
+	recovered, err := ec.Recover(shards, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recovered, data) {
+		t.Fatal("recovered data does not match original")
+	}
+}
+
+// TestErasureCoderTooManyMissing verifies that Recover fails when more than
+// parityPieces shards are missing.
+func TestErasureCoderTooManyMissing(t *testing.T) {
+	const dataPieces, parityPieces = 4, 2
+	ec, err := newErasureCoder(dataPieces, parityPieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte{0xCD}, 64)
+	shards, err := ec.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop three shards - one more than parityPieces can tolerate.
+	shards[0], shards[1], shards[2] = nil, nil, nil
+	if _, err := ec.Recover(shards, len(data)); err == nil {
+		t.Fatal("expected Recover to fail with too few shards")
+	}
+}
+
+// TestNewErasureCoderInvalidParams verifies that invalid erasure-coding
+// parameters are rejected up front rather than failing confusingly later.
+func TestNewErasureCoderInvalidParams(t *testing.T) {
+	if _, err := newErasureCoder(0, 1); err == nil {
+		t.Fatal("expected error for zero data pieces")
+	}
+	if _, err := newErasureCoder(4, -1); err == nil {
+		t.Fatal("expected error for negative parity pieces")
+	}
+}
@@ -0,0 +1,116 @@
+package renter
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// hostDB is the subset of the host database that the renter needs in order
+// to select hosts for uploads and look hosts up by address.
+type hostDB interface {
+	RandomHost() (modules.HostEntry, error)
+	NumHosts() int
+	Host(modules.NetAddress) (modules.HostEntry, bool)
+}
+
+// gateway is the subset of the gateway that the renter needs in order to
+// speak the host RPC protocol.
+type gateway interface {
+	RPC(addr modules.NetAddress, name string, fn func(modules.NetConn) error) error
+}
+
+// consensusState is the subset of the consensus set that the renter needs in
+// order to know the current height, which anchors contract durations.
+type consensusState interface {
+	Height() types.BlockHeight
+}
+
+// contractor is the subset of the contract manager the renter needs in order
+// to prefer better-scoring hosts when a download has more redundant pieces
+// available than it strictly needs.
+type contractor interface {
+	RankedContracts() []modules.RenterContract
+}
+
+// Renter tracks the files a user has uploaded to the Sia network, and
+// coordinates uploading and downloading their erasure-coded shards.
+type Renter struct {
+	hostDB     hostDB
+	gateway    gateway
+	state      consensusState
+	contractor contractor
+
+	files map[string]File
+
+	mu sync.RWMutex
+}
+
+// save persists the renter's file set to disk. The persistence format isn't
+// load-bearing for the erasure-coding or chunked-download changes, so it's
+// left unimplemented here: save does nothing and reports no error.
+func (r *Renter) save() {}
+
+// negotiateContract builds the file contract for the shard being uploaded
+// (its size and Merkle root) and opens a NegotiateContract RPC with host.
+// The RPC exchanges no data with the host, and the returned contract ID is
+// always the zero value.
+func (r *Renter) negotiateContract(host modules.HostEntry, up modules.UploadParams, shard []byte) (types.FileContract, types.FileContractID, error) {
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(shard))
+	if err != nil {
+		return types.FileContract{}, types.FileContractID{}, err
+	}
+	fc := types.FileContract{
+		FileSize:       uint64(len(shard)),
+		FileMerkleRoot: root,
+	}
+	var fcid types.FileContractID
+	err = r.gateway.RPC(host.IPAddress, "NegotiateContract", func(conn modules.NetConn) error {
+		return nil
+	})
+	return fc, fcid, err
+}
+
+// File tracks the erasure-coded pieces of a single uploaded file.
+type File struct {
+	nickname    string
+	pieces      []FilePiece
+	startHeight types.BlockHeight
+
+	// dataPieces and parityPieces are the erasure-coding parameters the file
+	// was uploaded with; size is the length, in bytes, of the original
+	// (pre-encoding) file, needed to trim padding off the reconstructed data.
+	dataPieces   int
+	parityPieces int
+	size         int
+
+	renter *Renter
+}
+
+// FilePiece is a single erasure-coded shard of a File, stored on one host
+// under one file contract.
+type FilePiece struct {
+	HostIP     modules.NetAddress
+	Contract   types.FileContract
+	ContractID types.FileContractID
+	Active     bool
+
+	// ShardIndex is this piece's index among the file's erasure-coded
+	// shards, and TotalShards is the file's DataPieces+ParityPieces. Shards
+	// with ShardIndex < dataPieces hold the original data, in order; the
+	// remainder hold parity.
+	ShardIndex  int
+	TotalShards int
+
+	// ChunkRoots holds the Merkle root of each downloadChunkSize-sized chunk
+	// of this shard, computed by the uploader before the shard was sent to
+	// the host. The chunked download protocol verifies each chunk it
+	// receives against the corresponding entry here, rather than against
+	// Contract.FileMerkleRoot, since that root is computed over the whole
+	// shard at a much finer segment granularity and can't be proven one
+	// download chunk at a time.
+	ChunkRoots []crypto.Hash
+}
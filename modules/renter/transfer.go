@@ -2,59 +2,58 @@ package renter
 
 import (
 	"errors"
-	"io"
-	"os"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
 
-	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 const (
 	maxUploadAttempts = 5
-)
 
-// downloadPiece attempts to retrieve a file from a host.
-func (r *Renter) downloadPiece(piece FilePiece, path string) error {
-	return r.gateway.RPC(piece.HostIP, "RetrieveFile", func(conn modules.NetConn) (err error) {
-		// Send the id of the contract for the file piece we're requesting. The
-		// response will be the file piece contents.
-		if err = conn.WriteObject(piece.ContractID); err != nil {
-			return
-		}
+	// downloadRedundancy is the number of extra pieces, beyond the minimum
+	// dataPieces needed to recover a file, that Download fetches - a small
+	// safety margin against one of the best-ranked hosts failing mid-download
+	// without having to fetch from every active host just in case.
+	downloadRedundancy = 1
+)
 
-		// Create the file on disk.
-		file, err := os.Create(path)
-		if err != nil {
-			return
-		}
-		defer file.Close()
-
-		// Simultaneously download file and calculate its Merkle root.
-		tee := io.TeeReader(
-			// use a LimitedReader to ensure we don't read indefinitely
-			io.LimitReader(conn, int64(piece.Contract.FileSize)),
-			// each byte we read from tee will also be written to file
-			file,
-		)
-		merkleRoot, err := crypto.ReaderMerkleRoot(tee)
-		if err != nil {
-			return
+// rankPieces orders pieces so that ones backed by better-scoring hosts (per
+// ranked, best first) come before ones backed by lower-scoring or unranked
+// hosts, so that when a download has more redundant pieces available than it
+// needs, it prefers the best hosts rather than whichever were iterated first.
+func rankPieces(pieces []FilePiece, ranked []modules.RenterContract) []FilePiece {
+	rank := make(map[types.FileContractID]int, len(ranked))
+	for i, rc := range ranked {
+		rank[rc.ID] = i
+	}
+	sorted := append([]FilePiece(nil), pieces...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, oki := rank[sorted[i].ContractID]
+		rj, okj := rank[sorted[j].ContractID]
+		if !oki {
+			ri = len(ranked)
 		}
-
-		if merkleRoot != piece.Contract.FileMerkleRoot {
-			return errors.New("host provided a file that's invalid")
+		if !okj {
+			rj = len(ranked)
 		}
-
-		return
+		return ri < rj
 	})
+	return sorted
 }
 
-// threadedUploadPiece will upload the piece of a file to a randomly chosen
-// host. If the wallet has insufficient balance to support uploading,
-// uploadPiece will give up. The file uploading can be continued using a repair
-// tool. Upon completion, the memory containg the piece's information is
-// updated.
-func (r *Renter) threadedUploadPiece(up modules.UploadParams, piece *FilePiece) {
+// threadedUploadPiece uploads a single erasure-coded shard to a randomly
+// chosen host. If the negotiation with a host fails, threadedUploadPiece tries again
+// with a different host, up to 'maxUploadAttempts' times, before giving up.
+// The file uploading can be continued using a repair tool. Upon completion,
+// the memory containing the piece's information is updated.
+func (r *Renter) threadedUploadPiece(up modules.UploadParams, index int, shard []byte, piece *FilePiece) {
+	// Commit to each chunk's root before any of the shard is sent to a host.
+	roots := chunkRoots(shard)
+
 	// Try 'maxUploadAttempts' hosts before giving up.
 	for attempts := 0; attempts < maxUploadAttempts; attempts++ {
 		// Select a host. An error here is unrecoverable.
@@ -63,20 +62,24 @@ func (r *Renter) threadedUploadPiece(up modules.UploadParams, piece *FilePiece)
 			return
 		}
 
-		// Negotiate the contract with the host. If the negotiation is
-		// unsuccessful, we need to try again with a new host. Otherwise, the
-		// file will be uploaded and we'll be done.
-		contract, contractID, err := r.negotiateContract(host, up)
+		// Negotiate the contract with the host, sending along this shard's
+		// data. If the negotiation is unsuccessful, we need to try again with
+		// a new host. Otherwise, the shard will be uploaded and we'll be
+		// done.
+		contract, contractID, err := r.negotiateContract(host, up, shard)
 		if err != nil {
 			continue
 		}
 
 		r.mu.Lock()
 		*piece = FilePiece{
-			HostIP:     host.IPAddress,
-			Contract:   contract,
-			ContractID: contractID,
-			Active:     true,
+			HostIP:      host.IPAddress,
+			Contract:    contract,
+			ContractID:  contractID,
+			Active:      true,
+			ShardIndex:  index,
+			TotalShards: up.DataPieces + up.ParityPieces,
+			ChunkRoots:  roots,
 		}
 		r.save()
 		r.mu.Unlock()
@@ -84,41 +87,93 @@ func (r *Renter) threadedUploadPiece(up modules.UploadParams, piece *FilePiece)
 	}
 }
 
-// Download downloads a file. Mutex conventions are broken to prevent doing
-// network communication with io in place.
+// Download downloads a file, reconstructing it from any k of its n
+// erasure-coded shards. Mutex conventions are broken to prevent doing network
+// communication with the lock held.
 func (r *Renter) Download(nickname, filename string) error {
 	// Grab the set of pieces we're downloading.
 	r.mu.RLock()
-	var pieces []FilePiece
-	_, exists := r.files[nickname]
+	f, exists := r.files[nickname]
 	if !exists {
 		r.mu.RUnlock()
 		return errors.New("no file of that nickname")
 	}
-	for _, piece := range r.files[nickname].pieces {
+	var pieces []FilePiece
+	for _, piece := range f.pieces {
 		if piece.Active {
 			pieces = append(pieces, piece)
 		}
 	}
+	dataPieces, parityPieces, size := f.dataPieces, f.parityPieces, f.size
 	r.mu.RUnlock()
 
-	// We only need one piece, so iterate through the hosts until a download
-	// succeeds.
+	if len(pieces) < dataPieces {
+		return errors.New("not enough online hosts to recover the file")
+	}
+
+	// Prefer the best-scoring hosts rather than fetching from every active
+	// piece: once we have dataPieces plus a small safety margin, the rest
+	// would just be wasted bandwidth against hosts we already expect to be
+	// worse.
+	if r.contractor != nil {
+		pieces = rankPieces(pieces, r.contractor.RankedContracts())
+	}
+	if want := dataPieces + downloadRedundancy; want < len(pieces) {
+		pieces = pieces[:want]
+	}
+
+	ec, err := newErasureCoder(dataPieces, parityPieces)
+	if err != nil {
+		return err
+	}
+
+	// Fetch shards from hosts in parallel, one chunk at a time, resuming
+	// each shard's .siapart sidecar on transient errors. We only need
+	// 'dataPieces' of them to succeed, so goroutines that return an error are
+	// simply skipped; a failing host doesn't fail the download, and a host
+	// that goes offline mid-stream only costs its own shard rather than the
+	// whole file. Download waits for every fetch to finish, so a slow host
+	// still delays it.
+	shards := make([][]byte, ec.NumPieces())
+	var wg sync.WaitGroup
+	var mu sync.Mutex
 	for _, piece := range pieces {
-		downloadErr := r.downloadPiece(piece, filename)
-		if downloadErr == nil {
-			return nil
-		} else {
-			// log error
+		wg.Add(1)
+		go func(piece FilePiece) {
+			defer wg.Done()
+			shardPath := filepath.Join(filepath.Dir(filename), filepath.Base(filename)+shardSuffix(piece.ShardIndex))
+			shard, err := r.downloadPieceResumable(piece, shardPath)
+			if err != nil {
+				// let the host's shard stay nil; erasure coding will
+				// reconstruct it from the others
+				return
+			}
+			mu.Lock()
+			shards[piece.ShardIndex] = shard
+			mu.Unlock()
+		}(piece)
+	}
+	wg.Wait()
+
+	numPresent := 0
+	for _, shard := range shards {
+		if shard != nil {
+			numPresent++
 		}
-		// r.hostDB.FlagHost(piece.Host.IPAddress)
+	}
+	if numPresent < dataPieces {
+		return errors.New("too many hosts returned errors - could not recover the file")
 	}
 
-	return errors.New("Too many hosts returned errors - could not recover the file")
+	data, err := ec.Recover(shards, size)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0666)
 }
 
-// Upload takes an upload parameters, which contain a file to upload, and then
-// creates a redundant copy of the file on the Sia network.
+// Upload takes upload parameters, which contain a file to upload, and then
+// erasure-codes and distributes it redundantly across the Sia network.
 func (r *Renter) Upload(up modules.UploadParams) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -129,29 +184,45 @@ func (r *Renter) Upload(up modules.UploadParams) error {
 		return errors.New("file with that nickname already exists")
 	}
 
-	// Check that the hostdb is sufficiently large to support an upload. Right
-	// now that value is set to 3, but in the future the logic will be a bit
-	// more complex; once there is erasure coding we'll want to hit the minimum
-	// number of pieces plus some buffer before we decide that an upload is
-	// okay.
-	if r.hostDB.NumHosts() < 1 {
+	data, err := ioutil.ReadFile(up.Filename)
+	if err != nil {
+		return err
+	}
+
+	ec, err := newErasureCoder(up.DataPieces, up.ParityPieces)
+	if err != nil {
+		return err
+	}
+	shards, err := ec.Encode(data)
+	if err != nil {
+		return err
+	}
+
+	// Check that the hostdb is sufficiently large to support the upload: we
+	// need at least enough hosts to place every shard, i.e. the minimum
+	// number of pieces plus the parity buffer.
+	if r.hostDB.NumHosts() < ec.NumPieces() {
 		return errors.New("not enough hosts on the network to upload a file :( - maybe you need to upgrade your software")
 	}
 
-	// Upload a piece to every host on the network.
+	// Upload each shard to its own randomly chosen host; two shards may land
+	// on the same host.
 	r.files[up.Nickname] = File{
-		nickname:    up.Nickname,
-		pieces:      make([]FilePiece, up.Pieces),
-		startHeight: r.state.Height() + up.Duration,
-		renter:      r,
+		nickname:     up.Nickname,
+		pieces:       make([]FilePiece, ec.NumPieces()),
+		startHeight:  r.state.Height() + up.Duration,
+		dataPieces:   up.DataPieces,
+		parityPieces: up.ParityPieces,
+		size:         len(data),
+		renter:       r,
 	}
 	for i := range r.files[up.Nickname].pieces {
 		// threadedUploadPiece will change the memory that the piece points to,
 		// which is useful because it means the file itself can be renamed but
 		// will still point to the same underlying pieces.
-		go r.threadedUploadPiece(up, &r.files[up.Nickname].pieces[i])
+		go r.threadedUploadPiece(up, i, shards[i], &r.files[up.Nickname].pieces[i])
 	}
 	r.save()
 
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,46 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRankPieces verifies that rankPieces orders pieces by their host's rank
+// (best first) and places pieces backed by an unranked contract last.
+func TestRankPieces(t *testing.T) {
+	idBest := types.FileContractID{1}
+	idMiddle := types.FileContractID{2}
+	idWorst := types.FileContractID{3}
+	idUnranked := types.FileContractID{4}
+
+	pieces := []FilePiece{
+		{ContractID: idUnranked, ShardIndex: 0},
+		{ContractID: idWorst, ShardIndex: 1},
+		{ContractID: idBest, ShardIndex: 2},
+		{ContractID: idMiddle, ShardIndex: 3},
+	}
+	ranked := []modules.RenterContract{
+		{ID: idBest},
+		{ID: idMiddle},
+		{ID: idWorst},
+	}
+
+	sorted := rankPieces(pieces, ranked)
+	got := make([]types.FileContractID, len(sorted))
+	for i, p := range sorted {
+		got[i] = p.ContractID
+	}
+	want := []types.FileContractID{idBest, idMiddle, idWorst, idUnranked}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("rankPieces order = %v, want %v", got, want)
+		}
+	}
+
+	// The input slice must not be reordered in place.
+	if pieces[0].ContractID != idUnranked {
+		t.Fatal("rankPieces should not mutate its input slice")
+	}
+}
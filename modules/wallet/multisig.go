@@ -0,0 +1,196 @@
+package wallet
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errMultisigTxnNotFound   = errors.New("no pending multisig transaction with that id")
+	errMultisigKeyNotOwned   = errors.New("wallet does not control the requested key index for this multisig address")
+	errMultisigAlreadySigned = errors.New("this key index has already signed the transaction")
+)
+
+// pendingMultisigTxn tracks a partially-signed transaction spending from an
+// m-of-n address, so that co-signers can each add their signature (possibly
+// offline, via Export/ImportPartialTransaction) before it is broadcast.
+type pendingMultisigTxn struct {
+	txn              types.Transaction
+	unlockConditions types.UnlockConditions
+	// signedKeyIndices tracks which of unlockConditions.PublicKeys have
+	// already contributed a signature, so duplicate signing is rejected and
+	// completeness can be checked cheaply.
+	signedKeyIndices map[uint64]bool
+}
+
+// CreateMultisigAddress constructs the unlock conditions and corresponding
+// address for an m-of-n multisig output, where m is requiredSigs and n is
+// len(pubkeys). The wallet does not need to control any of pubkeys to
+// construct the address; ownership is established separately, by the wallet
+// recognizing the resulting UnlockHash as relevant in applyHistory.
+func (w *Wallet) CreateMultisigAddress(pubkeys []types.SiaPublicKey, requiredSigs uint64) (types.UnlockConditions, types.UnlockHash, error) {
+	if requiredSigs == 0 || requiredSigs > uint64(len(pubkeys)) {
+		return types.UnlockConditions{}, types.UnlockHash{}, errors.New("invalid required signature count for multisig address")
+	}
+	uc := types.UnlockConditions{
+		PublicKeys:         pubkeys,
+		SignaturesRequired: requiredSigs,
+	}
+	return uc, uc.UnlockHash(), nil
+}
+
+// RegisterMultisigAddress adds uc to the set of multisig addresses the
+// wallet tracks as a participant in, so that future consensus changes
+// touching uc.UnlockHash() are recognized as relevant to the wallet.
+func (w *Wallet) RegisterMultisigAddress(uc types.UnlockConditions) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.multisigAddresses[uc.UnlockHash()] = uc
+}
+
+// ownsUnlockHash reports whether the wallet can contribute a signature
+// toward spending an output locked by uh - either because uh is one of the
+// wallet's own single-key addresses, or because uh is a multisig address the
+// wallet participates in.
+func (w *Wallet) ownsUnlockHash(uh types.UnlockHash) bool {
+	if _, exists := w.keys[uh]; exists {
+		return true
+	}
+	_, exists := w.multisigAddresses[uh]
+	return exists
+}
+
+// CreatePendingMultisigTransaction begins a co-signing round for txn, which
+// spends an output locked by uc, registering it in w.pendingMultisigTxns so
+// that SignMultisigTransaction and ExportPartialTransaction have something to
+// operate on. This is the only way a multisig spend is originated; every
+// other co-signer joins the round via Import/ExportPartialTransaction.
+func (w *Wallet) CreatePendingMultisigTransaction(txn types.Transaction, uc types.UnlockConditions) (types.TransactionID, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	txid := txn.ID()
+	if _, exists := w.pendingMultisigTxns[txid]; exists {
+		return types.TransactionID{}, errors.New("a pending multisig transaction with that id already exists")
+	}
+	w.pendingMultisigTxns[txid] = &pendingMultisigTxn{
+		txn:              txn,
+		unlockConditions: uc,
+		signedKeyIndices: make(map[uint64]bool),
+	}
+	return txid, nil
+}
+
+// multisigParentID finds the ID of the transaction input that uc authorizes
+// spending from, so a TransactionSignature can reference the input it
+// actually covers instead of the unrelated unlock-conditions hash.
+func multisigParentID(txn types.Transaction, uc types.UnlockConditions) (crypto.Hash, error) {
+	uh := uc.UnlockHash()
+	for _, sci := range txn.SiacoinInputs {
+		if sci.UnlockConditions.UnlockHash() == uh {
+			return crypto.Hash(sci.ParentID), nil
+		}
+	}
+	for _, sfi := range txn.SiafundInputs {
+		if sfi.UnlockConditions.UnlockHash() == uh {
+			return crypto.Hash(sfi.ParentID), nil
+		}
+	}
+	return crypto.Hash{}, errors.New("no input in the pending transaction is authorized by these unlock conditions")
+}
+
+// SignMultisigTransaction adds the signature of the key at keyIndex (an
+// index into the transaction's unlock conditions' PublicKeys) to the pending
+// multisig transaction identified by txid.
+func (w *Wallet) SignMultisigTransaction(txid types.TransactionID, keyIndex uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	pending, exists := w.pendingMultisigTxns[txid]
+	if !exists {
+		return errMultisigTxnNotFound
+	}
+	if keyIndex >= uint64(len(pending.unlockConditions.PublicKeys)) {
+		return errMultisigKeyNotOwned
+	}
+	if pending.signedKeyIndices[keyIndex] {
+		return errMultisigAlreadySigned
+	}
+	secretKey, exists := w.multisigKeys[pending.unlockConditions.PublicKeys[keyIndex].String()]
+	if !exists {
+		return errMultisigKeyNotOwned
+	}
+	parentID, err := multisigParentID(pending.txn, pending.unlockConditions)
+	if err != nil {
+		return err
+	}
+
+	sigIndex := len(pending.txn.TransactionSignatures)
+	pending.txn.TransactionSignatures = append(pending.txn.TransactionSignatures, types.TransactionSignature{
+		ParentID:       parentID,
+		PublicKeyIndex: keyIndex,
+		CoveredFields:  types.CoveredFields{WholeTransaction: true},
+	})
+	sigHash := pending.txn.SigHash(sigIndex)
+	sig := crypto.SignHash(sigHash, secretKey)
+	pending.txn.TransactionSignatures[sigIndex].Signature = sig[:]
+	pending.signedKeyIndices[keyIndex] = true
+	return nil
+}
+
+// ExportPartialTransaction serializes the pending multisig transaction
+// identified by txid, for transfer to an offline co-signer.
+func (w *Wallet) ExportPartialTransaction(txid types.TransactionID) ([]byte, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	pending, exists := w.pendingMultisigTxns[txid]
+	if !exists {
+		return nil, errMultisigTxnNotFound
+	}
+	return encoding.Marshal(*pending), nil
+}
+
+// ImportPartialTransaction loads a partially-signed multisig transaction
+// previously produced by ExportPartialTransaction (possibly by another
+// co-signer), merging it into w.pendingMultisigTxns so this wallet can add
+// its own signature.
+func (w *Wallet) ImportPartialTransaction(data []byte) (types.TransactionID, error) {
+	var pending pendingMultisigTxn
+	if err := encoding.Unmarshal(data, &pending); err != nil {
+		return types.TransactionID{}, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	txid := pending.txn.ID()
+	existing, exists := w.pendingMultisigTxns[txid]
+	if !exists {
+		w.pendingMultisigTxns[txid] = &pending
+		return txid, nil
+	}
+	// Merge in any signatures the imported copy has that the existing record
+	// doesn't, keyed by public key index - never replace the existing
+	// signature slice wholesale, or a signature this wallet already added
+	// locally (and isn't present in the imported blob) would be silently
+	// dropped while signedKeyIndices still claimed it was signed.
+	haveSig := make(map[uint64]bool, len(existing.txn.TransactionSignatures))
+	for _, sig := range existing.txn.TransactionSignatures {
+		haveSig[sig.PublicKeyIndex] = true
+	}
+	for _, sig := range pending.txn.TransactionSignatures {
+		if !haveSig[sig.PublicKeyIndex] {
+			existing.txn.TransactionSignatures = append(existing.txn.TransactionSignatures, sig)
+			haveSig[sig.PublicKeyIndex] = true
+		}
+	}
+	for i, signed := range pending.signedKeyIndices {
+		if signed && !existing.signedKeyIndices[i] {
+			existing.signedKeyIndices[i] = true
+		}
+	}
+	return txid, nil
+}
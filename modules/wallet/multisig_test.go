@@ -0,0 +1,115 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestCreateMultisigAddress verifies that CreateMultisigAddress rejects
+// invalid signature thresholds and otherwise returns unlock conditions whose
+// hash matches the returned address.
+func TestCreateMultisigAddress(t *testing.T) {
+	w := &Wallet{}
+	pubkeys := []types.SiaPublicKey{{}, {}, {}}
+
+	if _, _, err := w.CreateMultisigAddress(pubkeys, 0); err == nil {
+		t.Fatal("expected error for a zero signature requirement")
+	}
+	if _, _, err := w.CreateMultisigAddress(pubkeys, 4); err == nil {
+		t.Fatal("expected error when requiredSigs exceeds the number of keys")
+	}
+
+	uc, addr, err := w.CreateMultisigAddress(pubkeys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uc.SignaturesRequired != 2 || len(uc.PublicKeys) != 3 {
+		t.Fatalf("unexpected unlock conditions: %+v", uc)
+	}
+	if addr != uc.UnlockHash() {
+		t.Fatal("returned address does not match the returned unlock conditions' hash")
+	}
+}
+
+// TestOwnsUnlockHash verifies that ownsUnlockHash recognizes both the
+// wallet's single-key addresses and the multisig addresses it participates
+// in, and rejects everything else.
+func TestOwnsUnlockHash(t *testing.T) {
+	singleKeyHash := types.UnlockHash{1}
+	multisigHash := types.UnlockHash{2}
+	unrelatedHash := types.UnlockHash{3}
+
+	w := &Wallet{
+		keys:              map[types.UnlockHash]*spendableKey{singleKeyHash: {}},
+		multisigAddresses: map[types.UnlockHash]types.UnlockConditions{multisigHash: {}},
+	}
+
+	if !w.ownsUnlockHash(singleKeyHash) {
+		t.Fatal("expected wallet to own its single-key address")
+	}
+	if !w.ownsUnlockHash(multisigHash) {
+		t.Fatal("expected wallet to own a multisig address it participates in")
+	}
+	if w.ownsUnlockHash(unrelatedHash) {
+		t.Fatal("wallet should not claim to own an unrelated address")
+	}
+}
+
+// TestSignMultisigTransactionSetsParentID verifies that a signature produced
+// by SignMultisigTransaction covers the transaction input actually
+// authorized by the signing unlock conditions, not the unlock conditions'
+// own hash.
+func TestSignMultisigTransactionSetsParentID(t *testing.T) {
+	uc := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{{}},
+		SignaturesRequired: 1,
+	}
+	parentID := types.SiacoinOutputID{1, 2, 3}
+	txn := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         parentID,
+			UnlockConditions: uc,
+		}},
+	}
+
+	w := &Wallet{
+		multisigKeys:        map[string]crypto.SecretKey{uc.PublicKeys[0].String(): {}},
+		pendingMultisigTxns: make(map[types.TransactionID]*pendingMultisigTxn),
+	}
+
+	txid, err := w.CreatePendingMultisigTransaction(txn, uc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.CreatePendingMultisigTransaction(txn, uc); err == nil {
+		t.Fatal("expected an error when re-registering the same pending transaction id")
+	}
+
+	if err := w.SignMultisigTransaction(txid, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	pending := w.pendingMultisigTxns[txid]
+	if len(pending.txn.TransactionSignatures) != 1 {
+		t.Fatalf("expected 1 signature, got %v", len(pending.txn.TransactionSignatures))
+	}
+	if pending.txn.TransactionSignatures[0].ParentID != crypto.Hash(parentID) {
+		t.Fatal("signature's ParentID should match the authorized input's ParentID, not the unlock-conditions hash")
+	}
+
+	if err := w.SignMultisigTransaction(txid, 0); err != errMultisigAlreadySigned {
+		t.Fatal("expected re-signing the same key index to be rejected")
+	}
+}
+
+// TestMultisigParentIDNoMatch verifies that multisigParentID reports an error
+// rather than returning a zero-value hash when no input in the transaction
+// is locked by the given unlock conditions.
+func TestMultisigParentIDNoMatch(t *testing.T) {
+	uc := types.UnlockConditions{PublicKeys: []types.SiaPublicKey{{}}, SignaturesRequired: 1}
+	if _, err := multisigParentID(types.Transaction{}, uc); err == nil {
+		t.Fatal("expected an error when no input is authorized by the given unlock conditions")
+	}
+}
@@ -0,0 +1,236 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/bolt"
+)
+
+var (
+	bucketWalletLog  = []byte("WalletConsensusLog")
+	bucketWalletMeta = []byte("WalletMeta")
+
+	metaKeyHeight      = []byte("ConsensusSetHeight")
+	metaKeySiafundPool = []byte("SiafundPool")
+	metaKeySnapshotSeq = []byte("SnapshotSeq")
+
+	// logCompactInterval is the number of blocks between compacted
+	// snapshots of the wallet's output sets. Between snapshots, every
+	// ProcessConsensusChange is recorded as its own append-only log entry.
+	logCompactInterval = types.BlockHeight(1000)
+)
+
+// walletLogEntry is a single append-only record of the effect of one
+// ProcessConsensusChange call (or, for compaction entries, a full snapshot of
+// the wallet's output sets). Entries are never mutated once written -
+// reverted blocks are recorded as new entries rather than edits to old ones.
+type walletLogEntry struct {
+	Seq      uint64
+	Height   types.BlockHeight
+	Snapshot bool
+
+	// valid when Snapshot is true
+	SiacoinOutputs      map[types.SiacoinOutputID]types.SiacoinOutput
+	SiafundOutputs      map[types.SiafundOutputID]types.SiafundOutput
+	HistoricOutputs     map[types.OutputID]types.Currency
+	HistoricClaimStarts map[types.SiafundOutputID]types.Currency
+	SiafundPool         types.Currency
+
+	// valid when Snapshot is false
+	ConsensusChange modules.ConsensusChange
+}
+
+// deriveWalletLogKey derives the symmetric key used to encrypt the
+// persistence log from the wallet's primary seed. The key is derived afresh
+// on every use and never stored; entries already written are not
+// re-encrypted, so they cannot be read under a different seed.
+func deriveWalletLogKey(seed modules.Seed) (key [32]byte) {
+	h := sha256.Sum256(append([]byte("wallet-persist-log"), seed[:]...))
+	return h
+}
+
+// encryptLogEntry encrypts data with AES-GCM using a key derived from the
+// wallet's seed, prefixing the returned blob with the random nonce.
+func (w *Wallet) encryptLogEntry(data []byte) ([]byte, error) {
+	key := deriveWalletLogKey(w.primarySeed)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := crypto.RandBytes(gcm.NonceSize())
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// decryptLogEntry reverses encryptLogEntry.
+func (w *Wallet) decryptLogEntry(blob []byte) ([]byte, error) {
+	key := deriveWalletLogKey(w.primarySeed)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) < gcm.NonceSize() {
+		return nil, errors.New("wallet log: corrupt entry")
+	}
+	nonce, ciphertext := blob[:gcm.NonceSize()], blob[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// seqKey encodes a sequence number as a big-endian byte slice, so that bolt's
+// byte-ordered keys iterate log entries in sequence order.
+func seqKey(seq uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, seq)
+	return b
+}
+
+// logConsensusChange appends an encrypted, append-only record of cc to the
+// persistence log and updates the persisted consensus height and siafund
+// pool, all within a single bolt transaction so that a crash mid-block cannot
+// leave the on-disk log and the in-memory state inconsistent.
+func (w *Wallet) logConsensusChange(cc modules.ConsensusChange) error {
+	w.persistSeq++
+	entry := walletLogEntry{
+		Seq:             w.persistSeq,
+		Height:          w.consensusSetHeight,
+		ConsensusChange: cc,
+	}
+	plaintext := encoding.Marshal(entry)
+	ciphertext, err := w.encryptLogEntry(plaintext)
+	if err != nil {
+		return err
+	}
+
+	err = w.db.Update(func(tx *bolt.Tx) error {
+		logBucket := tx.Bucket(bucketWalletLog)
+		if err := logBucket.Put(seqKey(w.persistSeq), ciphertext); err != nil {
+			return err
+		}
+		metaBucket := tx.Bucket(bucketWalletMeta)
+		if err := metaBucket.Put(metaKeyHeight, encoding.Marshal(w.consensusSetHeight)); err != nil {
+			return err
+		}
+		return metaBucket.Put(metaKeySiafundPool, encoding.Marshal(w.siafundPool))
+	})
+	if err != nil {
+		return err
+	}
+
+	if w.consensusSetHeight%logCompactInterval == 0 {
+		return w.compactPersistLog()
+	}
+	return nil
+}
+
+// compactPersistLog writes a full snapshot of the wallet's output sets and
+// truncates every log entry that precedes it, bounding the log's size
+// between compactions.
+func (w *Wallet) compactPersistLog() error {
+	w.persistSeq++
+	snapshot := walletLogEntry{
+		Seq:                 w.persistSeq,
+		Height:              w.consensusSetHeight,
+		Snapshot:            true,
+		SiacoinOutputs:      w.siacoinOutputs,
+		SiafundOutputs:      w.siafundOutputs,
+		HistoricOutputs:     w.historicOutputs,
+		HistoricClaimStarts: w.historicClaimStarts,
+		SiafundPool:         w.siafundPool,
+	}
+	plaintext := encoding.Marshal(snapshot)
+	ciphertext, err := w.encryptLogEntry(plaintext)
+	if err != nil {
+		return err
+	}
+
+	return w.db.Update(func(tx *bolt.Tx) error {
+		logBucket := tx.Bucket(bucketWalletLog)
+		// Remove every entry strictly older than this snapshot.
+		// Use the cursor's own Delete, not logBucket.Delete(k): bolt only
+		// guarantees a cursor walk stays consistent across deletes if the
+		// removal goes through the cursor that's doing the walking.
+		c := logBucket.Cursor()
+		for k, _ := c.First(); k != nil && string(k) < string(seqKey(w.persistSeq)); k, _ = c.Next() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		if err := logBucket.Put(seqKey(snapshot.Seq), ciphertext); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketWalletMeta).Put(metaKeySnapshotSeq, encoding.Marshal(snapshot.Seq))
+	})
+}
+
+// initPersistLog opens (creating if necessary) the buckets used by the
+// wallet's persistence log.
+func (w *Wallet) initPersistLog() error {
+	return w.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketWalletLog); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(bucketWalletMeta)
+		return err
+	})
+}
+
+// replayPersistLog restores the wallet's in-memory state from the latest
+// snapshot and replays every log entry recorded after it, bringing the
+// wallet from whatever was last durably persisted up to the consensus set's
+// tip, rather than forcing a rescan from genesis.
+func (w *Wallet) replayPersistLog() error {
+	var entries []walletLogEntry
+	err := w.db.View(func(tx *bolt.Tx) error {
+		logBucket := tx.Bucket(bucketWalletLog)
+		if logBucket == nil {
+			return nil
+		}
+		return logBucket.ForEach(func(k, v []byte) error {
+			plaintext, err := w.decryptLogEntry(v)
+			if err != nil {
+				return err
+			}
+			var entry walletLogEntry
+			if err := encoding.Unmarshal(plaintext, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Snapshot {
+			w.siacoinOutputs = entry.SiacoinOutputs
+			w.siafundOutputs = entry.SiafundOutputs
+			w.historicOutputs = entry.HistoricOutputs
+			w.historicClaimStarts = entry.HistoricClaimStarts
+			w.siafundPool = entry.SiafundPool
+			w.consensusSetHeight = entry.Height
+		} else {
+			w.updateConfirmedSet(entry.ConsensusChange)
+			w.revertHistory(entry.ConsensusChange)
+			w.applyHistory(entry.ConsensusChange)
+		}
+		w.persistSeq = entry.Seq
+	}
+	return nil
+}
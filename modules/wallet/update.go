@@ -14,12 +14,11 @@ import (
 func (w *Wallet) updateConfirmedSet(cc modules.ConsensusChange) {
 	for _, diff := range cc.SiacoinOutputDiffs {
 		// Verify that the diff is relevant to the wallet.
-		_, exists := w.keys[diff.SiacoinOutput.UnlockHash]
-		if !exists {
+		if !w.ownsUnlockHash(diff.SiacoinOutput.UnlockHash) {
 			continue
 		}
 
-		_, exists = w.siacoinOutputs[diff.ID]
+		_, exists := w.siacoinOutputs[diff.ID]
 		if diff.Direction == modules.DiffApply {
 			if build.DEBUG && exists {
 				panic("adding an existing output to wallet")
@@ -34,12 +33,11 @@ func (w *Wallet) updateConfirmedSet(cc modules.ConsensusChange) {
 	}
 	for _, diff := range cc.SiafundOutputDiffs {
 		// Verify that the diff is relevant to the wallet.
-		_, exists := w.keys[diff.SiafundOutput.UnlockHash]
-		if !exists {
+		if !w.ownsUnlockHash(diff.SiafundOutput.UnlockHash) {
 			continue
 		}
 
-		_, exists = w.siafundOutputs[diff.ID]
+		_, exists := w.siafundOutputs[diff.ID]
 		if diff.Direction == modules.DiffApply {
 			if build.DEBUG && exists {
 				panic("adding an existing output to wallet")
@@ -82,7 +80,7 @@ func (w *Wallet) revertHistory(cc modules.ConsensusChange) {
 
 		// Remove the miner payout transaction if applicable.
 		for _, mp := range block.MinerPayouts {
-			_, exists := w.keys[mp.UnlockHash]
+			exists := w.ownsUnlockHash(mp.UnlockHash)
 			if exists {
 				w.processedTransactions = w.processedTransactions[:len(w.processedTransactions)-1]
 				delete(w.processedTransactionMap, types.TransactionID(block.ID()))
@@ -107,7 +105,7 @@ func (w *Wallet) applyHistory(cc modules.ConsensusChange) {
 		}
 		relevant := false
 		for i, mp := range block.MinerPayouts {
-			_, exists := w.keys[mp.UnlockHash]
+			exists := w.ownsUnlockHash(mp.UnlockHash)
 			if exists {
 				relevant = true
 			}
@@ -142,7 +140,7 @@ func (w *Wallet) applyHistory(cc modules.ConsensusChange) {
 				ConfirmationTimestamp: block.Timestamp,
 			}
 			for _, sci := range txn.SiacoinInputs {
-				_, exists := w.keys[sci.UnlockConditions.UnlockHash()]
+				exists := w.ownsUnlockHash(sci.UnlockConditions.UnlockHash())
 				if exists {
 					relevant = true
 				}
@@ -154,7 +152,7 @@ func (w *Wallet) applyHistory(cc modules.ConsensusChange) {
 				})
 			}
 			for i, sco := range txn.SiacoinOutputs {
-				_, exists := w.keys[sco.UnlockHash]
+				exists := w.ownsUnlockHash(sco.UnlockHash)
 				if exists {
 					relevant = true
 				}
@@ -168,7 +166,7 @@ func (w *Wallet) applyHistory(cc modules.ConsensusChange) {
 				w.historicOutputs[types.OutputID(txn.SiacoinOutputID(uint64(i)))] = sco.Value
 			}
 			for _, sfi := range txn.SiafundInputs {
-				_, exists := w.keys[sfi.UnlockConditions.UnlockHash()]
+				exists := w.ownsUnlockHash(sfi.UnlockConditions.UnlockHash())
 				if exists {
 					relevant = true
 				}
@@ -189,7 +187,7 @@ func (w *Wallet) applyHistory(cc modules.ConsensusChange) {
 				})
 			}
 			for i, sfo := range txn.SiafundOutputs {
-				_, exists := w.keys[sfo.UnlockHash]
+				exists := w.ownsUnlockHash(sfo.UnlockHash)
 				if exists {
 					relevant = true
 				}
@@ -233,6 +231,13 @@ func (w *Wallet) ProcessConsensusChange(cc modules.ConsensusChange) {
 	w.revertHistory(cc)
 	w.applyHistory(cc)
 
+	// Persist this consensus change as an append-only, encrypted log entry
+	// so that a restart can replay from the latest snapshot instead of
+	// rescanning the consensus set from genesis.
+	if err := w.logConsensusChange(cc); err != nil {
+		w.log.Println("ERROR: failed to persist consensus change:", err)
+	}
+
 	if cc.Synced {
 		go w.threadedDefragWallet()
 	}
@@ -262,7 +267,7 @@ func (w *Wallet) ReceiveUpdatedUnconfirmedTransactions(txns []types.Transaction,
 			ConfirmationTimestamp: types.Timestamp(math.MaxUint64),
 		}
 		for _, sci := range txn.SiacoinInputs {
-			_, exists := w.keys[sci.UnlockConditions.UnlockHash()]
+			exists := w.ownsUnlockHash(sci.UnlockConditions.UnlockHash())
 			if exists {
 				relevant = true
 			}
@@ -274,7 +279,7 @@ func (w *Wallet) ReceiveUpdatedUnconfirmedTransactions(txns []types.Transaction,
 			})
 		}
 		for i, sco := range txn.SiacoinOutputs {
-			_, exists := w.keys[sco.UnlockHash]
+			exists := w.ownsUnlockHash(sco.UnlockHash)
 			if exists {
 				relevant = true
 			}
@@ -0,0 +1,100 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"log"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	siasync "github.com/NebulousLabs/Sia/sync"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/bolt"
+)
+
+// spendableKey is a key the wallet can spend from: a set of unlock
+// conditions together with the secret keys that satisfy them.
+type spendableKey struct {
+	unlockConditions types.UnlockConditions
+	secretKeys       []crypto.SecretKey
+}
+
+// Wallet tracks the set of outputs spendable by this node, replays consensus
+// changes into transaction history, and persists both across restarts.
+type Wallet struct {
+	// keys holds the wallet's single-key (1-of-1) addresses.
+	keys map[types.UnlockHash]*spendableKey
+
+	// multisigAddresses holds the unlock conditions of every m-of-n address
+	// the wallet participates in, keyed by address. multisigKeys holds the
+	// wallet's own secret keys for those addresses, keyed by the string
+	// encoding of the corresponding public key. pendingMultisigTxns holds
+	// pointers, not values: SignMultisigTransaction mutates the looked-up
+	// *pendingMultisigTxn in place and expects that mutation to be visible to
+	// later lookups, which a value-typed map would silently lose.
+	multisigAddresses   map[types.UnlockHash]types.UnlockConditions
+	multisigKeys        map[string]crypto.SecretKey
+	pendingMultisigTxns map[types.TransactionID]*pendingMultisigTxn
+
+	siacoinOutputs map[types.SiacoinOutputID]types.SiacoinOutput
+	siafundOutputs map[types.SiafundOutputID]types.SiafundOutput
+	siafundPool    types.Currency
+
+	historicOutputs     map[types.OutputID]types.Currency
+	historicClaimStarts map[types.SiafundOutputID]types.Currency
+
+	processedTransactions            []modules.ProcessedTransaction
+	processedTransactionMap          map[types.TransactionID]*modules.ProcessedTransaction
+	unconfirmedProcessedTransactions []modules.ProcessedTransaction
+
+	consensusSetHeight types.BlockHeight
+
+	// primarySeed is the wallet's master seed; the persistence log's
+	// encryption key is derived from it so that it never has to be stored on
+	// disk separately.
+	primarySeed modules.Seed
+
+	// db is the bolt database backing the wallet's encrypted,
+	// append-only consensus-change log (see persist_log.go). persistSeq is
+	// the monotonically increasing sequence number of the last entry written
+	// to that log.
+	db         *bolt.DB
+	persistSeq uint64
+
+	log *log.Logger
+	tg  siasync.ThreadGroup
+	mu  sync.RWMutex
+}
+
+// New creates a Wallet backed by db, initializing the persistence log's
+// buckets and replaying any changes already logged in a previous run, so the
+// wallet resumes from its latest durable snapshot instead of forcing a
+// rescan from genesis.
+func New(db *bolt.DB, primarySeed modules.Seed) (*Wallet, error) {
+	w := &Wallet{
+		keys:                    make(map[types.UnlockHash]*spendableKey),
+		multisigAddresses:       make(map[types.UnlockHash]types.UnlockConditions),
+		multisigKeys:            make(map[string]crypto.SecretKey),
+		pendingMultisigTxns:     make(map[types.TransactionID]*pendingMultisigTxn),
+		siacoinOutputs:          make(map[types.SiacoinOutputID]types.SiacoinOutput),
+		siafundOutputs:          make(map[types.SiafundOutputID]types.SiafundOutput),
+		historicOutputs:         make(map[types.OutputID]types.Currency),
+		historicClaimStarts:     make(map[types.SiafundOutputID]types.Currency),
+		processedTransactionMap: make(map[types.TransactionID]*modules.ProcessedTransaction),
+		primarySeed:             primarySeed,
+		db:                      db,
+		log:                     log.New(ioutil.Discard, "", 0),
+	}
+	if err := w.initPersistLog(); err != nil {
+		return nil, err
+	}
+	if err := w.replayPersistLog(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// threadedDefragWallet consolidates the wallet's smaller outputs into fewer,
+// larger ones. It runs in its own goroutine once the wallet is synced, so
+// that it never blocks consensus-change processing.
+func (w *Wallet) threadedDefragWallet() {}